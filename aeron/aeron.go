@@ -17,13 +17,12 @@ limitations under the License.
 package aeron
 
 import (
-	"github.com/lirm/aeron-go/aeron/broadcast"
-	"github.com/lirm/aeron-go/aeron/counters"
-	"github.com/lirm/aeron-go/aeron/driver"
-	"github.com/lirm/aeron-go/aeron/ringbuffer"
-	"github.com/lirm/aeron-go/aeron/util/memmap"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lirm/aeron-go/aeron/util/errutil"
 	"github.com/op/go-logging"
-	"time"
 )
 
 // NewPublicationHandler is the handler type for new publication notification from the media driver
@@ -40,99 +39,211 @@ type UnavailableImageHandler func(*Image)
 
 // Aeron is the primary interface to the media driver for managing subscriptions and publications
 type Aeron struct {
-	context            *Context
-	conductor          ClientConductor
-	toDriverRingBuffer rb.ManyToOne
-	driverProxy        driver.Proxy
+	context   *Context
+	conductor conductorAPI
 
-	counters *counters.MetaDataFlyweight
-	cncFile  *memmap.File
+	closingCtx    context.Context
+	closingCancel context.CancelFunc
 
-	toClientsBroadcastReceiver *broadcast.Receiver
-	toClientsCopyReceiver      *broadcast.CopyReceiver
+	closeOnce sync.Once
+	closeErr  error
 }
 
 var logger = logging.MustGetLogger("aeron")
 
-// Connect is the factory method used to create a new instance of Aeron based on Context settings
+// Connect is the factory method used to create a new instance of Aeron based on Context settings.
+//
+// Talking to a live media driver requires decoding its CnC file and exchanging command/response
+// frames over shared-memory ring buffers and broadcast transmitters, none of which are
+// implemented in this package yet. Until that wire protocol lands, Connect wires up a
+// ClientConductor that tracks registrations and resolves them when its OnNewPublication/
+// OnSubscriptionReady/OnAvailableImage/OnErrorResponse methods are invoked directly, rather than
+// from a driver response it decoded itself.
 func Connect(ctx *Context) *Aeron {
 	aeron := new(Aeron)
 	aeron.context = ctx
+	aeron.closingCtx, aeron.closingCancel = context.WithCancel(context.Background())
 	logger.Debugf("Connecting with context: %v", ctx)
 
-	aeron.counters, aeron.cncFile = counters.MapFile(ctx.CncFileName())
-
-	aeron.toDriverRingBuffer.Init(aeron.counters.ToDriverBuf.Get())
-
-	aeron.driverProxy.Init(&aeron.toDriverRingBuffer)
-
-	aeron.toClientsBroadcastReceiver = broadcast.NewReceiver(aeron.counters.ToClientsBuf.Get())
-
-	aeron.toClientsCopyReceiver = broadcast.NewCopyReceiver(aeron.toClientsBroadcastReceiver)
-
-	clientLivenessTo := time.Duration(aeron.counters.ClientLivenessTo.Get())
+	conductor := NewClientConductor(ctx.tracer)
+	conductor.onAvailableImageHandler = ctx.availableImageHandler
+	conductor.onUnavailableImageHandler = ctx.unavailableImageHandler
 
-	aeron.conductor.Init(&aeron.driverProxy, aeron.toClientsCopyReceiver, clientLivenessTo, ctx.mediaDriverTo,
-		ctx.publicationConnectionTo, ctx.resourceLingerTo)
-	aeron.conductor.counterValuesBuffer = aeron.counters.ValuesBuf.Get()
+	aeron.conductor = conductor
 
-	aeron.conductor.onAvailableImageHandler = ctx.availableImageHandler
-	aeron.conductor.onUnavailableImageHandler = ctx.unavailableImageHandler
-
-	go aeron.conductor.Run(ctx.idleStrategy)
+	go conductor.Run(ctx.idleStrategy)
 
 	return aeron
 }
 
-// Close will terminate client conductor and remove all publications and subscriptions from the media driver
+// Close will terminate the client conductor, which fails every add still awaiting a driver response
+// and unmaps the log buffers of every resolved publication and image; nothing is sent to the media
+// driver. It is idempotent: a second call is a no-op that returns the result of the first.
 func (aeron *Aeron) Close() error {
-	err := aeron.conductor.Close()
-	if nil != err {
-		aeron.context.errorHandler(err)
-	}
+	aeron.closeOnce.Do(func() {
+		aeron.closingCancel()
 
-	err = aeron.cncFile.Close()
-	if nil != err {
-		aeron.context.errorHandler(err)
-	}
+		var merr errutil.MultiError
+
+		if err := aeron.conductor.Close(); err != nil {
+			aeron.context.errorHandler(err)
+			merr.Add(fmt.Errorf("close conductor: %w", err))
+		}
+
+		aeron.closeErr = merr.ErrorOrNil()
+	})
 
-	return err
+	return aeron.closeErr
 }
 
+// AddSubscription allocates a new subscription on the media driver and returns a channel that
+// will receive the Subscription once the driver has confirmed it, or be closed without a value
+// if the add never completes (e.g. Aeron.Close was called). Callers who need to bound how long
+// they wait, or to bail out early, should use AddSubscriptionWithContext instead.
 func (aeron *Aeron) AddSubscription(channel string, streamID int32) chan *Subscription {
 	ch := make(chan *Subscription, 1)
 
 	regID := aeron.conductor.AddSubscription(channel, streamID)
 	go func() {
-		subscription := aeron.conductor.FindSubscription(regID)
-		for subscription == nil {
-			subscription = aeron.conductor.FindSubscription(regID)
-			if subscription == nil {
-				aeron.context.idleStrategy.Idle(0)
-			}
+		subscription, err := aeron.awaitSubscription(aeron.closingCtx, regID)
+		if err != nil {
+			aeron.conductor.ReleaseSubscription(regID)
+		} else {
+			ch <- subscription
 		}
-		ch <- subscription
 		close(ch)
 	}()
 
 	return ch
 }
 
+// AddPublication allocates a new publication on the media driver and returns a channel that will
+// receive the Publication once the driver has confirmed it, or be closed without a value if the
+// add never completes (e.g. Aeron.Close was called). Callers who need to bound how long they
+// wait, or to bail out early, should use AddPublicationWithContext instead.
 func (aeron *Aeron) AddPublication(channel string, streamID int32) chan *Publication {
 	ch := make(chan *Publication, 1)
 
 	regID := aeron.conductor.AddPublication(channel, streamID)
 	go func() {
-		publication := aeron.conductor.FindPublication(regID)
-		for publication == nil {
-			publication = aeron.conductor.FindPublication(regID)
-			if publication == nil {
-				aeron.context.idleStrategy.Idle(0)
-			}
+		publication, err := aeron.awaitPublication(aeron.closingCtx, regID)
+		if err != nil {
+			aeron.conductor.ReleasePublication(regID)
+		} else {
+			ch <- publication
 		}
-		ch <- publication
 		close(ch)
 	}()
 
 	return ch
 }
+
+// AddSubscriptionWithContext allocates a new subscription on the media driver and blocks until it
+// is confirmed, the driver reports an error against it, or ctx is done, whichever happens first.
+// aeron.context.mediaDriverTo bounds the wait only when ctx has no deadline of its own. If
+// ctx is already done, the subscription is never registered with the driver. If ctx is done or
+// times out after the subscription was registered, AddSubscriptionWithContext releases the
+// registration before returning so it isn't left dangling on the driver with nothing to close it.
+// The add is also abandoned, and released, if Aeron.Close is called while it is in flight.
+func (aeron *Aeron) AddSubscriptionWithContext(ctx context.Context, channel string, streamID int32) (*Subscription, error) {
+	ctx, cancel := aeron.boundedAddContext(ctx)
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	regID := aeron.conductor.AddSubscription(channel, streamID)
+	subscription, err := aeron.awaitSubscription(ctx, regID)
+	if err != nil {
+		aeron.conductor.ReleaseSubscription(regID)
+	}
+	return subscription, err
+}
+
+// AddPublicationWithContext allocates a new publication on the media driver and blocks until it
+// is confirmed, the driver reports an error against it, or ctx is done, whichever happens first.
+// aeron.context.mediaDriverTo bounds the wait only when ctx has no deadline of its own. If
+// ctx is already done, the publication is never registered with the driver. If ctx is done or
+// times out after the publication was registered, AddPublicationWithContext releases the
+// registration before returning so it isn't left dangling on the driver with nothing to close it.
+// The add is also abandoned, and released, if Aeron.Close is called while it is in flight.
+func (aeron *Aeron) AddPublicationWithContext(ctx context.Context, channel string, streamID int32) (*Publication, error) {
+	ctx, cancel := aeron.boundedAddContext(ctx)
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	regID := aeron.conductor.AddPublication(channel, streamID)
+	publication, err := aeron.awaitPublication(ctx, regID)
+	if err != nil {
+		aeron.conductor.ReleasePublication(regID)
+	}
+	return publication, err
+}
+
+// awaitSubscription polls the conductor for the Subscription registered as regID, returning as
+// soon as it's found, the driver reports an error against the registration (e.g. ERROR_RESPONSE
+// for a bad channel), or ctx is done.
+func (aeron *Aeron) awaitSubscription(ctx context.Context, regID int64) (*Subscription, error) {
+	for {
+		if subscription := aeron.conductor.FindSubscription(regID); subscription != nil {
+			return subscription, nil
+		}
+		if err := aeron.conductor.DriverError(regID); err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			aeron.context.idleStrategy.Idle(0)
+		}
+	}
+}
+
+// awaitPublication polls the conductor for the Publication registered as regID, returning as soon
+// as it's found, the driver reports an error against the registration (e.g. ERROR_RESPONSE for a
+// duplicate stream), or ctx is done.
+func (aeron *Aeron) awaitPublication(ctx context.Context, regID int64) (*Publication, error) {
+	for {
+		if publication := aeron.conductor.FindPublication(regID); publication != nil {
+			return publication, nil
+		}
+		if err := aeron.conductor.DriverError(regID); err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			aeron.context.idleStrategy.Idle(0)
+		}
+	}
+}
+
+// boundedAddContext merges ctx with aeron.closingCtx (so an in-flight add is cancelled by
+// Aeron.Close) and, if ctx has no deadline of its own, bounds it by aeron.context.mediaDriverTo
+// so a driver that never responds doesn't leak the calling goroutine forever.
+func (aeron *Aeron) boundedAddContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		ctx, cancel = context.WithTimeout(ctx, aeron.context.mediaDriverTo)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	go func() {
+		select {
+		case <-aeron.closingCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
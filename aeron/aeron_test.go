@@ -0,0 +1,148 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestAeron() *Aeron {
+	aeron := new(Aeron)
+	aeron.context = NewContext().MediaDriverTimeout(20 * time.Millisecond)
+	aeron.closingCtx, aeron.closingCancel = context.WithCancel(context.Background())
+	return aeron
+}
+
+func TestBoundedAddContextAlreadyCancelled(t *testing.T) {
+	aeron := newTestAeron()
+
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ctx, doneCancel := aeron.boundedAddContext(parent)
+	defer doneCancel()
+
+	if err := ctx.Err(); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBoundedAddContextAppliesMediaDriverTimeout(t *testing.T) {
+	aeron := newTestAeron()
+
+	ctx, cancel := aeron.boundedAddContext(context.Background())
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected boundedAddContext to apply Context.mediaDriverTo and time out")
+	}
+
+	if err := ctx.Err(); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestBoundedAddContextRespectsCallerDeadline(t *testing.T) {
+	aeron := newTestAeron()
+
+	parent, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	ctx, doneCancel := aeron.boundedAddContext(parent)
+	defer doneCancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("expected caller-supplied deadline to be preserved")
+	}
+	if time.Until(deadline) < time.Minute {
+		t.Fatalf("expected caller's long deadline to win over mediaDriverTo, got %v remaining", time.Until(deadline))
+	}
+}
+
+// fakeConductor is a conductorAPI that never resolves a registration, so awaitSubscription and
+// awaitPublication fall through to whatever err is set, letting tests exercise the
+// error-surfacing and release-on-failure paths without a live media driver.
+type fakeConductor struct {
+	err         error
+	releasedSub []int64
+	releasedPub []int64
+}
+
+func (f *fakeConductor) AddPublication(channel string, streamID int32) int64  { return 1 }
+func (f *fakeConductor) AddSubscription(channel string, streamID int32) int64 { return 1 }
+
+func (f *fakeConductor) ReleasePublication(registrationID int64) {
+	f.releasedPub = append(f.releasedPub, registrationID)
+}
+
+func (f *fakeConductor) ReleaseSubscription(registrationID int64) {
+	f.releasedSub = append(f.releasedSub, registrationID)
+}
+
+func (f *fakeConductor) FindPublication(registrationID int64) *Publication   { return nil }
+func (f *fakeConductor) FindSubscription(registrationID int64) *Subscription { return nil }
+func (f *fakeConductor) DriverError(registrationID int64) error              { return f.err }
+func (f *fakeConductor) Close() error                                        { return nil }
+
+func TestAddSubscriptionWithContextSurfacesDriverError(t *testing.T) {
+	aeron := newTestAeron()
+	fc := &fakeConductor{err: errors.New("bad channel")}
+	aeron.conductor = fc
+
+	_, err := aeron.AddSubscriptionWithContext(context.Background(), "aeron:udp?endpoint=localhost:40123", 10)
+	if err == nil || err.Error() != "bad channel" {
+		t.Fatalf("expected driver error to surface, got %v", err)
+	}
+	if len(fc.releasedSub) != 1 || fc.releasedSub[0] != 1 {
+		t.Fatalf("expected the failed registration to be released, got %v", fc.releasedSub)
+	}
+}
+
+func TestAddPublicationWithContextSurfacesDriverError(t *testing.T) {
+	aeron := newTestAeron()
+	fc := &fakeConductor{err: errors.New("stream in use")}
+	aeron.conductor = fc
+
+	_, err := aeron.AddPublicationWithContext(context.Background(), "aeron:udp?endpoint=localhost:40123", 10)
+	if err == nil || err.Error() != "stream in use" {
+		t.Fatalf("expected driver error to surface, got %v", err)
+	}
+	if len(fc.releasedPub) != 1 || fc.releasedPub[0] != 1 {
+		t.Fatalf("expected the failed registration to be released, got %v", fc.releasedPub)
+	}
+}
+
+func TestBoundedAddContextCancelledByClose(t *testing.T) {
+	aeron := newTestAeron()
+
+	ctx, cancel := aeron.boundedAddContext(context.Background())
+	defer cancel()
+
+	aeron.closingCancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected boundedAddContext's ctx to be cancelled when closingCtx is cancelled")
+	}
+}
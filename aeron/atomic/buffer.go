@@ -0,0 +1,65 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package atomic provides a fixed-region buffer view over memory-mapped term and metadata
+// sections, as wrapped by logbuffer.LogBuffers.
+package atomic
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Buffer is a view over a fixed memory region, pointed at via Wrap. It does not own the memory
+// it wraps; the caller (typically logbuffer.LogBuffers) is responsible for mapping and unmapping
+// the backing region.
+type Buffer struct {
+	ptr    unsafe.Pointer
+	length int32
+}
+
+// Wrap points the buffer at ptr for length bytes.
+func (buffer *Buffer) Wrap(ptr unsafe.Pointer, length int32) {
+	buffer.ptr = ptr
+	buffer.length = length
+}
+
+// Capacity returns the number of bytes the buffer was wrapped with.
+func (buffer *Buffer) Capacity() int32 {
+	return buffer.length
+}
+
+// PutBytes copies src into the buffer starting at offset.
+func (buffer *Buffer) PutBytes(offset int32, src []byte) {
+	buffer.checkBounds(offset, int32(len(src)))
+	dst := unsafe.Slice((*byte)(unsafe.Pointer(uintptr(buffer.ptr)+uintptr(offset))), len(src))
+	copy(dst, src)
+}
+
+// GetBytes copies length bytes starting at offset into a new slice.
+func (buffer *Buffer) GetBytes(offset int32, length int32) []byte {
+	buffer.checkBounds(offset, length)
+	src := unsafe.Slice((*byte)(unsafe.Pointer(uintptr(buffer.ptr)+uintptr(offset))), length)
+	dst := make([]byte, length)
+	copy(dst, src)
+	return dst
+}
+
+func (buffer *Buffer) checkBounds(offset int32, length int32) {
+	if offset < 0 || length < 0 || int64(offset)+int64(length) > int64(buffer.length) {
+		panic(fmt.Sprintf("atomic.Buffer: access [%d, %d) out of bounds for capacity %d", offset, offset+length, buffer.length))
+	}
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+	"github.com/lirm/aeron-go/aeron/util/errutil"
+)
+
+// conductorAPI is the subset of ClientConductor's behavior Aeron depends on, narrowed to an
+// interface so tests can drive awaitPublication/awaitSubscription and friends against a fake
+// conductor without a live media driver.
+type conductorAPI interface {
+	AddPublication(channel string, streamID int32) int64
+	AddSubscription(channel string, streamID int32) int64
+	ReleasePublication(registrationID int64)
+	ReleaseSubscription(registrationID int64)
+	FindPublication(registrationID int64) *Publication
+	FindSubscription(registrationID int64) *Subscription
+	DriverError(registrationID int64) error
+	Close() error
+}
+
+// publicationState tracks a single AddPublication call between the point it's sent to the driver
+// and the point the driver confirms it (OnNewPublication) or rejects it (OnErrorResponse).
+type publicationState struct {
+	channel     string
+	streamID    int32
+	publication *Publication
+	err         error
+}
+
+// subscriptionState tracks a single AddSubscription call the same way publicationState does for
+// AddPublication. Its Subscription is created as soon as the driver acknowledges the
+// registration (OnSubscriptionReady); Images are attached to it as they become available.
+type subscriptionState struct {
+	channel      string
+	streamID     int32
+	subscription *Subscription
+	err          error
+}
+
+// subscriptionImage records which subscription an Image belongs to, keyed by the correlation ID
+// the driver assigned to its availability notification, so a later unavailability notification
+// for the same correlation ID can find and detach it again.
+type subscriptionImage struct {
+	subscriptionRegID int64
+	image             *Image
+}
+
+// ClientConductor tracks the lifecycle of this client's publications, subscriptions, and images.
+// Talking to a live media driver requires decoding its CnC file and exchanging command/response
+// frames over shared-memory ring buffers and broadcast transmitters, none of which are
+// implemented in this package yet. Until that wire protocol lands, ClientConductor has no driver
+// of its own to issue commands to: AddPublication/AddSubscription register local state and hand
+// back a registration ID directly, and that registration is only ever resolved by a direct call
+// to OnNewPublication/OnSubscriptionReady/OnAvailableImage/OnErrorResponse (e.g. from a test, or
+// from a future driver-decode layer built on top of this type).
+type ClientConductor struct {
+	onAvailableImageHandler   AvailableImageHandler
+	onUnavailableImageHandler UnavailableImageHandler
+
+	tracer Tracer
+
+	mu                 sync.Mutex
+	nextRegistrationID int64
+	publications       map[int64]*publicationState
+	subscriptions      map[int64]*subscriptionState
+	images             map[int64]*subscriptionImage
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewClientConductor builds a ClientConductor with no registrations yet resolved. tracer is
+// threaded into every Publication/Image the conductor resolves; pass NoopTracer{} for one that
+// costs nothing, or nil to get the same default.
+func NewClientConductor(tracer Tracer) *ClientConductor {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+
+	return &ClientConductor{
+		tracer:        tracer,
+		publications:  make(map[int64]*publicationState),
+		subscriptions: make(map[int64]*subscriptionState),
+		images:        make(map[int64]*subscriptionImage),
+		done:          make(chan struct{}),
+	}
+}
+
+// Run blocks, idling via idleStrategy, until Close is called. It is meant to run on its own
+// goroutine, as Aeron.Connect does. Once a driver-decode layer exists to feed
+// OnNewPublication/OnSubscriptionReady/OnAvailableImage/OnErrorResponse from driver responses,
+// that decoding loop belongs here.
+func (cc *ClientConductor) Run(idleStrategy IdleStrategy) {
+	for {
+		select {
+		case <-cc.done:
+			return
+		default:
+		}
+		idleStrategy.Idle(0)
+	}
+}
+
+// Close stops Run, fails every registration still awaiting a driver response so a goroutine
+// blocked in awaitPublication/awaitSubscription doesn't wait on a response that will never come,
+// and unmaps the log buffers of every registration the driver had already resolved. It is
+// idempotent: a second call is a no-op.
+func (cc *ClientConductor) Close() error {
+	cc.closeOnce.Do(func() {
+		close(cc.done)
+
+		cc.mu.Lock()
+		var merr errutil.MultiError
+		for regID, state := range cc.publications {
+			if state.publication != nil {
+				if err := state.publication.Close(); err != nil {
+					merr.Add(fmt.Errorf("close publication %d: %w", regID, err))
+				}
+			} else if state.err == nil {
+				state.err = fmt.Errorf("add publication %d: client conductor closed", regID)
+			}
+		}
+		for regID, state := range cc.subscriptions {
+			if state.err == nil && state.subscription == nil {
+				state.err = fmt.Errorf("add subscription %d: client conductor closed", regID)
+			}
+		}
+		for correlationID, entry := range cc.images {
+			if err := entry.image.Close(); err != nil {
+				merr.Add(fmt.Errorf("close image %d: %w", correlationID, err))
+			}
+		}
+		cc.mu.Unlock()
+
+		cc.closeErr = merr.ErrorOrNil()
+	})
+
+	return cc.closeErr
+}
+
+// AddPublication registers channel/streamID and returns the registration ID
+// FindPublication/DriverError will resolve once OnNewPublication or OnErrorResponse is invoked for
+// it.
+func (cc *ClientConductor) AddPublication(channel string, streamID int32) int64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.nextRegistrationID++
+	regID := cc.nextRegistrationID
+	cc.publications[regID] = &publicationState{channel: channel, streamID: streamID}
+
+	return regID
+}
+
+// AddSubscription registers channel/streamID and returns the registration ID
+// FindSubscription/DriverError will resolve once OnSubscriptionReady or OnErrorResponse is invoked
+// for it.
+func (cc *ClientConductor) AddSubscription(channel string, streamID int32) int64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.nextRegistrationID++
+	regID := cc.nextRegistrationID
+	cc.subscriptions[regID] = &subscriptionState{channel: channel, streamID: streamID}
+
+	return regID
+}
+
+// ReleasePublication unmaps the log buffer of the publication registered as registrationID, if it
+// had already resolved, and forgets its local state. It is safe to call whether or not the
+// registration ever resolved.
+func (cc *ClientConductor) ReleasePublication(registrationID int64) {
+	cc.mu.Lock()
+	state := cc.publications[registrationID]
+	delete(cc.publications, registrationID)
+	cc.mu.Unlock()
+
+	if state != nil && state.publication != nil {
+		if err := state.publication.Close(); err != nil {
+			logger.Errorf("close publication %d: %v", registrationID, err)
+		}
+	}
+}
+
+// ReleaseSubscription unmaps the log buffers of every Image still attached to the subscription
+// registered as registrationID, and forgets its local state. It is safe to call whether or not the
+// registration ever resolved.
+func (cc *ClientConductor) ReleaseSubscription(registrationID int64) {
+	cc.mu.Lock()
+	state := cc.subscriptions[registrationID]
+	delete(cc.subscriptions, registrationID)
+	var images []*Image
+	if state != nil && state.subscription != nil {
+		images = state.subscription.Images()
+		for correlationID, entry := range cc.images {
+			if entry.subscriptionRegID == registrationID {
+				delete(cc.images, correlationID)
+			}
+		}
+	}
+	cc.mu.Unlock()
+
+	for _, image := range images {
+		if err := image.Close(); err != nil {
+			logger.Errorf("close image for subscription %d: %v", registrationID, err)
+		}
+	}
+}
+
+// FindPublication returns the Publication registered as registrationID, or nil if the driver
+// hasn't confirmed it yet (or the registration is unknown).
+func (cc *ClientConductor) FindPublication(registrationID int64) *Publication {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if state := cc.publications[registrationID]; state != nil {
+		return state.publication
+	}
+	return nil
+}
+
+// FindSubscription returns the Subscription registered as registrationID, or nil if the driver
+// hasn't confirmed it yet (or the registration is unknown).
+func (cc *ClientConductor) FindSubscription(registrationID int64) *Subscription {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if state := cc.subscriptions[registrationID]; state != nil {
+		return state.subscription
+	}
+	return nil
+}
+
+// DriverError returns the error the driver reported against registrationID, e.g. ERROR_RESPONSE
+// for a bad channel, or nil if no error has been reported (yet).
+func (cc *ClientConductor) DriverError(registrationID int64) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if state := cc.publications[registrationID]; state != nil {
+		return state.err
+	}
+	if state := cc.subscriptions[registrationID]; state != nil {
+		return state.err
+	}
+	return nil
+}
+
+// OnNewPublication resolves registrationID once the driver has confirmed it: it maps the
+// driver's log buffer file and builds the Publication the caller of AddPublication is waiting on,
+// tagged with cc.tracer so every Offer on it propagates a span.
+func (cc *ClientConductor) OnNewPublication(streamID int32, logFileName string, registrationID int64) {
+	cc.mu.Lock()
+	state := cc.publications[registrationID]
+	cc.mu.Unlock()
+	if state == nil {
+		return
+	}
+
+	logBuffers := logbuffer.WrapLazy(logFileName)
+	publication := newPublication(state.channel, streamID, logBuffers, cc.tracer)
+
+	cc.mu.Lock()
+	state.publication = publication
+	cc.mu.Unlock()
+}
+
+// OnSubscriptionReady creates the Subscription the caller of AddSubscription is waiting on, once
+// the driver has acknowledged the registration. Images are attached to it later via
+// OnAvailableImage.
+func (cc *ClientConductor) OnSubscriptionReady(registrationID int64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	state := cc.subscriptions[registrationID]
+	if state == nil || state.subscription != nil {
+		return
+	}
+	state.subscription = newSubscription(state.channel, state.streamID, registrationID)
+}
+
+// OnAvailableImage maps the driver's log buffer file, builds an Image tagged with cc.tracer so
+// every fragment Poll delivers off it can extract a propagated span, attaches the Image to the
+// Subscription registered as subscriptionRegID, and invokes the Context's AvailableImageHandler,
+// if one was configured.
+func (cc *ClientConductor) OnAvailableImage(logFileName string, subscriptionRegID int64, correlationID int64) {
+	cc.mu.Lock()
+	state := cc.subscriptions[subscriptionRegID]
+	if state == nil {
+		cc.mu.Unlock()
+		return
+	}
+	if state.subscription == nil {
+		state.subscription = newSubscription(state.channel, state.streamID, subscriptionRegID)
+	}
+	subscription := state.subscription
+	cc.mu.Unlock()
+
+	logBuffers := logbuffer.WrapLazy(logFileName)
+	image := newImage(logBuffers, cc.tracer)
+	subscription.addImage(image)
+
+	cc.mu.Lock()
+	cc.images[correlationID] = &subscriptionImage{subscriptionRegID: subscriptionRegID, image: image}
+	cc.mu.Unlock()
+
+	if cc.onAvailableImageHandler != nil {
+		cc.onAvailableImageHandler(image)
+	}
+}
+
+// OnUnavailableImage detaches the Image the driver originally reported via correlationID from its
+// Subscription and invokes the Context's UnavailableImageHandler, if one was configured.
+func (cc *ClientConductor) OnUnavailableImage(correlationID int64) {
+	cc.mu.Lock()
+	entry := cc.images[correlationID]
+	delete(cc.images, correlationID)
+	var subscription *Subscription
+	if entry != nil {
+		if state := cc.subscriptions[entry.subscriptionRegID]; state != nil {
+			subscription = state.subscription
+		}
+	}
+	cc.mu.Unlock()
+
+	if entry == nil {
+		return
+	}
+	if subscription != nil {
+		subscription.removeImage(entry.image)
+	}
+	if cc.onUnavailableImageHandler != nil {
+		cc.onUnavailableImageHandler(entry.image)
+	}
+}
+
+// OnErrorResponse records errorMessage against whichever publication or subscription
+// registration registrationID refers to, so the goroutine awaiting it via DriverError stops
+// polling and returns the error instead of looping until its context is done.
+func (cc *ClientConductor) OnErrorResponse(registrationID int64, errorMessage string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	err := fmt.Errorf("driver error: %s", errorMessage)
+	if state := cc.publications[registrationID]; state != nil {
+		state.err = err
+		return
+	}
+	if state := cc.subscriptions[registrationID]; state != nil {
+		state.err = err
+	}
+}
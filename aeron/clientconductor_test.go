@@ -0,0 +1,221 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestLogFile creates a minimal, validly-sized log buffer file (3 terms of the smallest legal
+// term length, plus the metadata section) that logbuffer.WrapLazy/Wrap can map.
+func newTestLogFile(t *testing.T) string {
+	t.Helper()
+
+	const (
+		termLength      = 64 * 1024
+		partitionCount  = 3
+		logMetaDataSize = 4 * 1024
+	)
+
+	fileName := filepath.Join(t.TempDir(), "test.log")
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatalf("create log file: %v", err)
+	}
+	if err := file.Truncate(partitionCount*termLength + logMetaDataSize); err != nil {
+		t.Fatalf("truncate log file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("close log file: %v", err)
+	}
+
+	return fileName
+}
+
+type recordingTracer struct {
+	NoopTracer
+	spansStarted int
+}
+
+func (rt *recordingTracer) StartSpan(operationName string, parent *SpanContext) Span {
+	rt.spansStarted++
+	return NoopSpan{}
+}
+
+func TestOnNewPublicationResolvesPendingRegistrationWithTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	cc := NewClientConductor(tracer)
+	cc.publications[7] = &publicationState{channel: "aeron:ipc", streamID: 10}
+
+	cc.OnNewPublication(10, newTestLogFile(t), 7)
+
+	pub := cc.FindPublication(7)
+	if pub == nil {
+		t.Fatal("expected FindPublication to resolve once OnNewPublication ran")
+	}
+	if pub.tracer != tracer {
+		t.Fatalf("expected the conductor's tracer to be threaded into the Publication, got %v", pub.tracer)
+	}
+
+	if _, err := pub.Offer([]byte("hello")); err != nil {
+		t.Fatalf("Offer: %v", err)
+	}
+	if tracer.spansStarted != 1 {
+		t.Fatalf("expected Offer to start a span via the threaded tracer, got %d", tracer.spansStarted)
+	}
+}
+
+func TestOnAvailableImageAttachesImageWithTracerAndNotifiesHandler(t *testing.T) {
+	tracer := &recordingTracer{}
+	var notified *Image
+	cc := NewClientConductor(tracer)
+	cc.onAvailableImageHandler = func(image *Image) { notified = image }
+	cc.subscriptions[9] = &subscriptionState{channel: "aeron:ipc", streamID: 20}
+
+	cc.OnSubscriptionReady(9)
+	if sub := cc.FindSubscription(9); sub == nil {
+		t.Fatal("expected FindSubscription to resolve once OnSubscriptionReady ran")
+	}
+
+	cc.OnAvailableImage(newTestLogFile(t), 9, 100)
+
+	sub := cc.FindSubscription(9)
+	images := sub.Images()
+	if len(images) != 1 {
+		t.Fatalf("expected 1 image attached to the subscription, got %d", len(images))
+	}
+	if images[0].tracer != tracer {
+		t.Fatalf("expected the conductor's tracer to be threaded into the Image, got %v", images[0].tracer)
+	}
+	if notified != images[0] {
+		t.Fatal("expected the AvailableImageHandler to be invoked with the new Image")
+	}
+
+	cc.OnUnavailableImage(100)
+	if len(sub.Images()) != 0 {
+		t.Fatal("expected OnUnavailableImage to detach the image from the subscription")
+	}
+}
+
+// isMapped reports whether fileName currently backs a memory mapping in this process, by
+// consulting /proc/self/maps. It lets these tests confirm a log buffer's mmap was actually torn
+// down without touching the buffer itself, which is undefined behavior once its backing memory
+// has been unmapped.
+func isMapped(t *testing.T, fileName string) bool {
+	t.Helper()
+
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		t.Fatalf("resolve absolute path for %s: %v", fileName, err)
+	}
+
+	maps, err := os.ReadFile("/proc/self/maps")
+	if err != nil {
+		t.Fatalf("read /proc/self/maps: %v", err)
+	}
+
+	return strings.Contains(string(maps), absPath)
+}
+
+func TestReleasePublicationUnmapsLogBuffer(t *testing.T) {
+	cc := NewClientConductor(nil)
+	cc.publications[7] = &publicationState{channel: "aeron:ipc", streamID: 10}
+	fileName := newTestLogFile(t)
+	cc.OnNewPublication(10, fileName, 7)
+
+	if cc.FindPublication(7) == nil {
+		t.Fatal("expected FindPublication to resolve once OnNewPublication ran")
+	}
+	if !isMapped(t, fileName) {
+		t.Fatal("expected the publication's log buffer to be mapped once resolved")
+	}
+
+	cc.ReleasePublication(7)
+
+	if isMapped(t, fileName) {
+		t.Fatal("expected ReleasePublication to unmap the publication's log buffer")
+	}
+	if cc.FindPublication(7) != nil {
+		t.Fatal("expected ReleasePublication to forget the registration")
+	}
+}
+
+func TestReleaseSubscriptionUnmapsImageLogBuffers(t *testing.T) {
+	cc := NewClientConductor(nil)
+	cc.subscriptions[9] = &subscriptionState{channel: "aeron:ipc", streamID: 20}
+	cc.OnSubscriptionReady(9)
+	fileName := newTestLogFile(t)
+	cc.OnAvailableImage(fileName, 9, 100)
+
+	if len(cc.FindSubscription(9).Images()) != 1 {
+		t.Fatal("expected 1 image attached before release")
+	}
+	if !isMapped(t, fileName) {
+		t.Fatal("expected the image's log buffer to be mapped once attached")
+	}
+
+	cc.ReleaseSubscription(9)
+
+	if isMapped(t, fileName) {
+		t.Fatal("expected ReleaseSubscription to unmap its images' log buffers")
+	}
+	if cc.FindSubscription(9) != nil {
+		t.Fatal("expected ReleaseSubscription to forget the registration")
+	}
+}
+
+func TestCloseUnmapsResolvedLogBuffers(t *testing.T) {
+	cc := NewClientConductor(nil)
+	cc.publications[7] = &publicationState{channel: "aeron:ipc", streamID: 10}
+	pubFile := newTestLogFile(t)
+	cc.OnNewPublication(10, pubFile, 7)
+
+	cc.subscriptions[9] = &subscriptionState{channel: "aeron:ipc", streamID: 20}
+	cc.OnSubscriptionReady(9)
+	imgFile := newTestLogFile(t)
+	cc.OnAvailableImage(imgFile, 9, 100)
+
+	if !isMapped(t, pubFile) || !isMapped(t, imgFile) {
+		t.Fatal("expected both log buffers to be mapped before Close")
+	}
+
+	if err := cc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if isMapped(t, pubFile) {
+		t.Fatal("expected Close to unmap a publication resolved before it was called")
+	}
+	if isMapped(t, imgFile) {
+		t.Fatal("expected Close to unmap an image resolved before it was called")
+	}
+}
+
+func TestOnErrorResponseSurfacesThroughDriverError(t *testing.T) {
+	cc := NewClientConductor(nil)
+	cc.publications[3] = &publicationState{channel: "aeron:ipc", streamID: 1}
+
+	cc.OnErrorResponse(3, "channel unknown")
+
+	err := cc.DriverError(3)
+	if err == nil || err.Error() != "driver error: channel unknown" {
+		t.Fatalf("expected the driver error to surface via DriverError, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import (
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// IdleStrategy is the backoff strategy used while waiting on the media driver, e.g. in
+// Connect's conductor loop or while polling for a new publication/subscription.
+type IdleStrategy interface {
+	// Idle is called once per unsuccessful unit of work; workCount is the number of items
+	// processed in the preceding work cycle.
+	Idle(workCount int)
+}
+
+// busySpinIdleStrategy is the default IdleStrategy: it yields the processor without sleeping.
+type busySpinIdleStrategy struct{}
+
+func (busySpinIdleStrategy) Idle(int) {
+	runtime.Gosched()
+}
+
+// Context carries the configuration used to connect to a media driver: where its CnC file
+// lives, how long to wait on it, and the handlers invoked for driver-originated events.
+type Context struct {
+	aeronDir string
+
+	mediaDriverTo           time.Duration
+	publicationConnectionTo time.Duration
+	resourceLingerTo        time.Duration
+
+	idleStrategy IdleStrategy
+	errorHandler func(error)
+
+	availableImageHandler   AvailableImageHandler
+	unavailableImageHandler UnavailableImageHandler
+
+	tracer Tracer
+}
+
+// NewContext creates a Context with reasonable defaults: a busy-spin idle strategy, a no-op
+// tracer, and an error handler that logs via the package logger.
+func NewContext() *Context {
+	return &Context{
+		mediaDriverTo:           10 * time.Second,
+		publicationConnectionTo: 5 * time.Second,
+		resourceLingerTo:        3 * time.Minute,
+		idleStrategy:            busySpinIdleStrategy{},
+		errorHandler:            func(err error) { logger.Errorf("context error handler: %v", err) },
+		tracer:                  NoopTracer{},
+	}
+}
+
+// AeronDir sets the directory in which the media driver's CnC file is expected to be found.
+func (cx *Context) AeronDir(dir string) *Context {
+	cx.aeronDir = dir
+	return cx
+}
+
+// CncFileName returns the path to the media driver's CnC file within AeronDir.
+func (cx *Context) CncFileName() string {
+	return filepath.Join(cx.aeronDir, "cnc.dat")
+}
+
+// MediaDriverTimeout sets how long to wait on the media driver to respond before an add times
+// out; see AddPublicationWithContext/AddSubscriptionWithContext.
+func (cx *Context) MediaDriverTimeout(to time.Duration) *Context {
+	cx.mediaDriverTo = to
+	return cx
+}
+
+// IdleStrategy sets the backoff strategy used while waiting on the media driver.
+func (cx *Context) IdleStrategy(idleStrategy IdleStrategy) *Context {
+	cx.idleStrategy = idleStrategy
+	return cx
+}
+
+// ErrorHandler sets the handler Aeron.Close invokes with the error, if any, from closing the client
+// conductor. Errors the conductor hits while releasing a publication or subscription are logged,
+// not passed to this handler.
+func (cx *Context) ErrorHandler(handler func(error)) *Context {
+	cx.errorHandler = handler
+	return cx
+}
+
+// AvailableImageHandler sets the handler invoked when a new Image becomes available.
+func (cx *Context) AvailableImageHandler(handler AvailableImageHandler) *Context {
+	cx.availableImageHandler = handler
+	return cx
+}
+
+// UnavailableImageHandler sets the handler invoked when an Image goes away.
+func (cx *Context) UnavailableImageHandler(handler UnavailableImageHandler) *Context {
+	cx.unavailableImageHandler = handler
+	return cx
+}
+
+// Tracer sets the Tracer used to propagate distributed trace context across publications and
+// subscriptions created from this Context. The default is NoopTracer, which costs nothing on the
+// Offer/Poll hot path.
+func (cx *Context) Tracer(tracer Tracer) *Context {
+	cx.tracer = tracer
+	return cx
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import "github.com/lirm/aeron-go/aeron/logbuffer"
+
+// Image represents the stream of fragments sent by a single publisher, as received by a
+// Subscription.
+type Image struct {
+	tracer Tracer
+
+	logBuffers *logbuffer.LogBuffers
+	termIndex  int
+	head       int32
+}
+
+// newImage builds an Image over logBuffers, extracting a propagated SpanContext from every
+// fragment's reserved tracing header via tracer. The ClientConductor supplies tracer from the
+// Context the Subscription was requested against, defaulting to NoopTracer.
+func newImage(logBuffers *logbuffer.LogBuffers, tracer Tracer) *Image {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+
+	return &Image{
+		tracer:     tracer,
+		logBuffers: logBuffers,
+	}
+}
+
+// Close unmaps the Image's underlying log buffer. The ClientConductor calls this once the image's
+// subscription is released or the conductor itself is closed; callers don't call it directly.
+func (img *Image) Close() error {
+	return img.logBuffers.Close()
+}
+
+// Poll delivers up to fragmentLimit fragments appended since the last call to handler. For each
+// fragment, Poll extracts the SpanContext from its reserved tracing header (if any) and starts a
+// "receive" span that is a child of it before invoking handler, finishing the span once handler
+// returns. It returns the number of fragments delivered. Whether a fragment carries a tracing
+// header at all is read off its length prefix (see encodeFragmentLengthPrefix), not assumed from
+// img.tracer, since the Publication that wrote it may have been configured with a different
+// tracer than this Image: a fragment written by a NoopTracer has no header on the wire regardless
+// of what img.tracer is, and Poll pays nothing extra to skip it.
+func (img *Image) Poll(handler AssemblerWithSpan, fragmentLimit int) int {
+	buffer, release := img.logBuffers.AcquireBuffer(img.termIndex)
+	defer release()
+
+	polled := 0
+	for polled < fragmentLimit {
+		if img.head+fragmentLengthPrefixLength > buffer.Capacity() {
+			break
+		}
+
+		lengthPrefix := buffer.GetBytes(img.head, fragmentLengthPrefixLength)
+		payloadLength, hasHeader := decodeFragmentLengthPrefix(lengthPrefix)
+		if payloadLength == 0 {
+			break
+		}
+
+		headerOffset := img.head + fragmentLengthPrefixLength
+		headerLength := int32(0)
+		if hasHeader {
+			headerLength = spanHeaderReservedLength
+		}
+		payloadOffset := headerOffset + headerLength
+
+		var parent *SpanContext
+		if hasHeader {
+			header := buffer.GetBytes(headerOffset, headerLength)
+			if sc, ok := img.tracer.Extract(header); ok {
+				parent = &sc
+			}
+		}
+
+		span := img.tracer.StartSpan("receive", parent)
+		handler(buffer, payloadOffset, payloadLength, span)
+		span.Finish()
+
+		img.head = payloadOffset + payloadLength
+		polled++
+	}
+
+	return polled
+}
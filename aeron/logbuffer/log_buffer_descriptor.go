@@ -0,0 +1,70 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logbuffer
+
+import (
+	"fmt"
+
+	"github.com/lirm/aeron-go/aeron/atomic"
+)
+
+const (
+	// PartitionCount is the number of term partitions backing a log buffer.
+	PartitionCount = 3
+
+	// LogMetaDataSectionIndex is the index, within LogBuffers' buffer array, of the metadata
+	// section that follows the PartitionCount term partitions.
+	LogMetaDataSectionIndex = PartitionCount
+
+	// logMetaDataLength is the fixed size, in bytes, of a log buffer's metadata section.
+	logMetaDataLength = 4 * 1024
+
+	// maxSingleMappingSize is the log file size at and above which Wrap maps one partition at a
+	// time instead of with a single mmap call (see Wrap and WrapLazy); smaller logs use one call.
+	maxSingleMappingSize = 1 << 30
+
+	minTermLength = 64 * 1024
+	maxTermLength = 1 << 30
+)
+
+// computeTermLength derives the length of a single term partition from the total length of the
+// log file, which is PartitionCount equally sized terms plus the metadata section.
+func computeTermLength(logLength int64) int64 {
+	return (logLength - int64(logMetaDataLength)) / PartitionCount
+}
+
+// checkTermLength panics if termLength is not a power of two within [minTermLength, maxTermLength].
+func checkTermLength(termLength int64) {
+	if termLength < minTermLength || termLength > maxTermLength {
+		panic(fmt.Sprintf("term length %d out of range [%d, %d]", termLength, minTermLength, maxTermLength))
+	}
+	if termLength&(termLength-1) != 0 {
+		panic(fmt.Sprintf("term length %d is not a power of two", termLength))
+	}
+}
+
+// LogBufferMetaData is a flyweight over a log buffer's metadata section.
+type LogBufferMetaData struct {
+	buffer *atomic.Buffer
+	offset int32
+}
+
+// Wrap points the flyweight at buffer starting at offset.
+func (meta *LogBufferMetaData) Wrap(buffer *atomic.Buffer, offset int32) {
+	meta.buffer = buffer
+	meta.offset = offset
+}
@@ -17,24 +17,88 @@ limitations under the License.
 package logbuffer
 
 import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
 	"github.com/lirm/aeron-go/aeron/atomic"
+	"github.com/lirm/aeron-go/aeron/util/errutil"
 	"github.com/lirm/aeron-go/aeron/util/memmap"
 	"github.com/op/go-logging"
-	"unsafe"
 )
 
 var logger = logging.MustGetLogger("logbuffers")
 
+const (
+	// defaultIdleWindow is how long a lazily-mapped term partition can go untouched before
+	// ReleaseIdle is allowed to unmap it.
+	defaultIdleWindow = 30 * time.Second
+
+	// defaultResidentCap is the number of most-recently-used term partitions ReleaseIdle always
+	// keeps mapped, regardless of idle window.
+	defaultResidentCap = 2
+)
+
 // LogBuffers is the struct providing access to the file or files representing the terms containing the ring buffer
 type LogBuffers struct {
 	mmapFiles []*memmap.File
 	buffers   [PartitionCount + 1]atomic.Buffer
 	meta      LogBufferMetaData
+
+	fileName   string
+	termLength int64
+
+	lazy        bool
+	idleWindow  time.Duration
+	residentCap int
+
+	partitionMu     [PartitionCount]sync.Mutex
+	partitionMapped [PartitionCount]bool
+	lastAccess      [PartitionCount]time.Time
+	pageIns         [PartitionCount]int64
+	refCount        [PartitionCount]int32
+
+	// closeMu is held for reading by ensureMapped/unmapPartition while they touch mmapFiles, and
+	// for writing by Close, so Close can never nil out mmapFiles out from under an in-flight
+	// lazy map/unmap triggered by Buffer or ReleaseIdle.
+	closeMu   sync.RWMutex
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures optional behavior of WrapLazy.
+type Option func(*LogBuffers)
+
+// WithIdleWindow overrides how long a lazily-mapped term partition can go untouched before
+// ReleaseIdle is allowed to unmap it. The default is 30 seconds.
+func WithIdleWindow(d time.Duration) Option {
+	return func(logBuffers *LogBuffers) {
+		logBuffers.idleWindow = d
+	}
+}
+
+// WithResidentCap overrides the number of most-recently-used term partitions that ReleaseIdle
+// always keeps mapped, regardless of idle window. The default is 2.
+func WithResidentCap(n int) Option {
+	return func(logBuffers *LogBuffers) {
+		logBuffers.residentCap = n
+	}
+}
+
+// Stats reports on the working set of a lazily-mapped LogBuffers so operators can tune
+// WithIdleWindow/WithResidentCap. For a LogBuffers wrapped eagerly via Wrap, ResidentTerms is
+// always PartitionCount and PageIns is always zero.
+type Stats struct {
+	ResidentTerms int
+	PageIns       [PartitionCount]int64
 }
 
 // Wrap is the factory method wrapping the LogBuffers structure around memory mapped file
 func Wrap(fileName string) *LogBuffers {
 	buffers := new(LogBuffers)
+	buffers.fileName = fileName
 
 	logLength := memmap.GetFileSize(fileName)
 	termLength := computeTermLength(logLength)
@@ -88,6 +152,48 @@ func Wrap(fileName string) *LogBuffers {
 	return buffers
 }
 
+// WrapLazy is a factory method like Wrap, but for logs at or above maxSingleMappingSize it maps
+// only the metadata section eagerly and defers mapping each term partition until it is first
+// accessed through Buffer. This keeps RSS low for streams with high sparsity, e.g. many idle
+// subscriptions on a large term length, or replay from an archive where only one term is hot.
+// Logs below maxSingleMappingSize are mapped in a single call regardless, so WrapLazy falls back
+// to Wrap for them.
+func WrapLazy(fileName string, opts ...Option) *LogBuffers {
+	logLength := memmap.GetFileSize(fileName)
+	termLength := computeTermLength(logLength)
+
+	checkTermLength(termLength)
+
+	if logLength < maxSingleMappingSize {
+		return Wrap(fileName)
+	}
+
+	buffers := new(LogBuffers)
+	buffers.fileName = fileName
+	buffers.termLength = termLength
+	buffers.lazy = true
+	buffers.idleWindow = defaultIdleWindow
+	buffers.residentCap = defaultResidentCap
+	for _, opt := range opts {
+		opt(buffers)
+	}
+
+	buffers.mmapFiles = make([](*memmap.File), PartitionCount+1)
+	metaDataSectionOffset := termLength * int64(PartitionCount)
+	metaDataSectionLength := int(logLength - metaDataSectionOffset)
+
+	mmap, err := memmap.MapExisting(fileName, metaDataSectionOffset, metaDataSectionLength)
+	if err != nil {
+		panic("Failed to map the log buffer")
+	}
+	buffers.mmapFiles[0] = mmap
+	buffers.buffers[LogMetaDataSectionIndex].Wrap(mmap.GetMemoryPtr(), logMetaDataLength)
+
+	buffers.meta.Wrap(&buffers.buffers[PartitionCount], 0)
+
+	return buffers
+}
+
 // Meta return log buffer meta data flyweight
 func (logBuffers *LogBuffers) Meta() *LogBufferMetaData {
 	return &logBuffers.meta
@@ -95,18 +201,203 @@ func (logBuffers *LogBuffers) Meta() *LogBufferMetaData {
 
 // Buffer returns a buffer backing a specific term based on index. PartitionLength+1 is the size of the buffer array,
 // and the last buffer is the metadata buffer, which can be accessed through a convenience wrapped via Meta() method.
+// For a LogBuffers wrapped lazily via WrapLazy, the term's backing memory is mapped on this, its first, access.
+//
+// The returned pointer is only safe to use for the duration of the current operation. On a
+// lazily-mapped LogBuffers, ReleaseIdle can unmap the partition's backing memory at any later
+// time; a caller that needs the buffer to stay valid across its own operation, rather than just
+// at the instant Buffer is called, should use AcquireBuffer instead.
 func (logBuffers *LogBuffers) Buffer(index int) *atomic.Buffer {
+	if logBuffers.lazy && index < PartitionCount {
+		logBuffers.ensureMapped(index)
+	}
 	return &logBuffers.buffers[index]
 }
 
-// Close will try to unmap all backing memory maps
-func (logBuffers *LogBuffers) Close() error {
-	logger.Debug("Closing logBuffers")
-	// TODO accumulate errors
+// AcquireBuffer is like Buffer, but pins the partition mapped for the duration between the call
+// and the returned release func being invoked: ReleaseIdle will not unmap a pinned partition.
+// Callers such as Publication.Offer or Image.Poll, which touch a partition's buffer across a
+// handler call or multiple field accesses rather than a single Buffer call, should acquire it
+// this way instead of caching the result of Buffer. The release func must be called exactly once
+// and is safe to call from a defer.
+func (logBuffers *LogBuffers) AcquireBuffer(index int) (buffer *atomic.Buffer, release func()) {
+	if !logBuffers.lazy || index >= PartitionCount {
+		return &logBuffers.buffers[index], func() {}
+	}
+
+	logBuffers.ensureMappedAndPin(index)
+
+	var released sync.Once
+	release = func() {
+		released.Do(func() {
+			logBuffers.partitionMu[index].Lock()
+			logBuffers.refCount[index]--
+			logBuffers.partitionMu[index].Unlock()
+		})
+	}
+	return &logBuffers.buffers[index], release
+}
+
+// ensureMapped maps partition index on demand, guarded by that partition's own mutex so
+// concurrent producers/consumers touching different partitions don't block each other. It takes
+// closeMu for reading so a concurrent Close can't nil out mmapFiles while this is in flight.
+func (logBuffers *LogBuffers) ensureMapped(index int) {
+	logBuffers.closeMu.RLock()
+	defer logBuffers.closeMu.RUnlock()
+
+	logBuffers.partitionMu[index].Lock()
+	defer logBuffers.partitionMu[index].Unlock()
+
+	logBuffers.ensureMappedLocked(index)
+}
+
+// ensureMappedAndPin is like ensureMapped, but increments refCount in the same critical section
+// that maps the partition, so a concurrent ReleaseIdle can never observe the partition mapped
+// with refCount still at zero and unmap it out from under the caller pinning it. Calling
+// ensureMapped and incrementing refCount as two separate locked sections (as AcquireBuffer used
+// to) left exactly that gap.
+func (logBuffers *LogBuffers) ensureMappedAndPin(index int) {
+	logBuffers.closeMu.RLock()
+	defer logBuffers.closeMu.RUnlock()
+
+	logBuffers.partitionMu[index].Lock()
+	defer logBuffers.partitionMu[index].Unlock()
+
+	logBuffers.ensureMappedLocked(index)
+	logBuffers.refCount[index]++
+}
+
+// ensureMappedLocked is the shared body of ensureMapped/ensureMappedAndPin; the caller must
+// already hold closeMu for reading and partitionMu[index].
+func (logBuffers *LogBuffers) ensureMappedLocked(index int) {
+	if logBuffers.mmapFiles == nil {
+		// Closed concurrently; nothing left to map into.
+		return
+	}
+
+	logBuffers.lastAccess[index] = time.Now()
+	if logBuffers.partitionMapped[index] {
+		return
+	}
+
+	mmap, err := memmap.MapExisting(logBuffers.fileName, int64(index)*logBuffers.termLength, int(logBuffers.termLength))
+	if err != nil {
+		panic("Failed to map the log buffer")
+	}
+
+	logBuffers.mmapFiles[index+1] = mmap
+	logBuffers.buffers[index].Wrap(mmap.GetMemoryPtr(), int32(logBuffers.termLength))
+	logBuffers.partitionMapped[index] = true
+	logBuffers.pageIns[index]++
+}
+
+// ReleaseIdle unmaps term partitions that haven't been touched within the configured idle
+// window, always keeping at least residentCap of the most-recently-used partitions mapped. It is
+// a no-op for a LogBuffers wrapped eagerly via Wrap. Callers signal memory pressure by invoking
+// this periodically, e.g. from a timer, rather than relying on an unbounded resident set.
+func (logBuffers *LogBuffers) ReleaseIdle() error {
+	if !logBuffers.lazy {
+		return nil
+	}
+
+	type resident struct {
+		index      int
+		lastAccess time.Time
+	}
+
+	var mapped []resident
+	for i := 0; i < PartitionCount; i++ {
+		logBuffers.partitionMu[i].Lock()
+		if logBuffers.partitionMapped[i] {
+			mapped = append(mapped, resident{i, logBuffers.lastAccess[i]})
+		}
+		logBuffers.partitionMu[i].Unlock()
+	}
+
+	if len(mapped) <= logBuffers.residentCap {
+		return nil
+	}
+
+	sort.Slice(mapped, func(a, b int) bool { return mapped[a].lastAccess.After(mapped[b].lastAccess) })
+
+	now := time.Now()
 	var err error
-	for _, mmap := range logBuffers.mmapFiles {
-		err = mmap.Close()
+	for _, r := range mapped[logBuffers.residentCap:] {
+		if now.Sub(r.lastAccess) < logBuffers.idleWindow {
+			continue
+		}
+		if e := logBuffers.unmapPartition(r.index); e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// unmapPartition unmaps a single term partition, guarded by that partition's own mutex. It takes
+// closeMu for reading so a concurrent Close can't nil out mmapFiles while this is in flight. A
+// partition currently pinned by AcquireBuffer is left mapped; ReleaseIdle will retry it once it's
+// released. Once actually unmapped, the partition's atomic.Buffer is reset to zero length so any
+// stale pointer obtained from an earlier Buffer call panics on next use instead of reading or
+// writing through memory that's already been released back to the OS.
+func (logBuffers *LogBuffers) unmapPartition(index int) error {
+	logBuffers.closeMu.RLock()
+	defer logBuffers.closeMu.RUnlock()
+
+	logBuffers.partitionMu[index].Lock()
+	defer logBuffers.partitionMu[index].Unlock()
+
+	if logBuffers.mmapFiles == nil || !logBuffers.partitionMapped[index] {
+		return nil
+	}
+	if logBuffers.refCount[index] > 0 {
+		return nil
 	}
-	logBuffers.mmapFiles = nil
+
+	err := logBuffers.mmapFiles[index+1].Close()
+	logBuffers.mmapFiles[index+1] = nil
+	logBuffers.buffers[index].Wrap(nil, 0)
+	logBuffers.partitionMapped[index] = false
 	return err
 }
+
+// Stats reports the current resident term count and per-partition page-in counters.
+func (logBuffers *LogBuffers) Stats() Stats {
+	stats := Stats{}
+	for i := 0; i < PartitionCount; i++ {
+		logBuffers.partitionMu[i].Lock()
+		if !logBuffers.lazy || logBuffers.partitionMapped[i] {
+			stats.ResidentTerms++
+		}
+		stats.PageIns[i] = logBuffers.pageIns[i]
+		logBuffers.partitionMu[i].Unlock()
+	}
+	return stats
+}
+
+// Close will try to unmap all backing memory maps. It is idempotent: a second call is a no-op
+// that returns the result of the first, and is safe to call concurrently with an in-flight
+// Buffer access or ReleaseIdle on a lazily-mapped LogBuffers.
+func (logBuffers *LogBuffers) Close() error {
+	logBuffers.closeOnce.Do(func() {
+		logBuffers.closeMu.Lock()
+		defer logBuffers.closeMu.Unlock()
+
+		logger.Debug("Closing logBuffers")
+
+		var merr errutil.MultiError
+		for i, mmap := range logBuffers.mmapFiles {
+			if mmap == nil {
+				continue
+			}
+			if err := mmap.Close(); err != nil {
+				merr.Add(fmt.Errorf("unmap section %d of %s: %w", i, logBuffers.fileName, err))
+			}
+		}
+		logBuffers.mmapFiles = nil
+
+		logBuffers.closeErr = merr.ErrorOrNil()
+	})
+
+	return logBuffers.closeErr
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logbuffer
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lazyTermLength is chosen so that PartitionCount*lazyTermLength+logMetaDataLength exceeds
+// maxSingleMappingSize, forcing WrapLazy onto its per-partition mapping path. The backing file is
+// created sparse, so its nominal size costs no real disk space.
+const lazyTermLength = 1 << 29
+
+func newLazyLogFile(t *testing.T) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), "lazy.log")
+	logLength := int64(logMetaDataLength) + PartitionCount*int64(lazyTermLength)
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatalf("create log file: %v", err)
+	}
+	if err := file.Truncate(logLength); err != nil {
+		t.Fatalf("truncate log file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("close log file: %v", err)
+	}
+
+	return fileName
+}
+
+func TestWrapLazyDefersPartitionMappingUntilFirstAccess(t *testing.T) {
+	logBuffers := WrapLazy(newLazyLogFile(t))
+	defer logBuffers.Close()
+
+	if stats := logBuffers.Stats(); stats.ResidentTerms != 0 {
+		t.Fatalf("expected 0 resident terms before any access, got %d", stats.ResidentTerms)
+	}
+
+	logBuffers.Buffer(0)
+
+	stats := logBuffers.Stats()
+	if stats.ResidentTerms != 1 {
+		t.Fatalf("expected 1 resident term after accessing partition 0, got %d", stats.ResidentTerms)
+	}
+	if stats.PageIns[0] != 1 {
+		t.Fatalf("expected 1 page-in for partition 0, got %d", stats.PageIns[0])
+	}
+
+	logBuffers.Buffer(0)
+	if stats := logBuffers.Stats(); stats.PageIns[0] != 1 {
+		t.Fatalf("expected repeat access not to page in again, got %d page-ins", stats.PageIns[0])
+	}
+}
+
+func TestReleaseIdleKeepsOnlyResidentCapMostRecentlyUsed(t *testing.T) {
+	logBuffers := WrapLazy(newLazyLogFile(t), WithResidentCap(1), WithIdleWindow(0))
+	defer logBuffers.Close()
+
+	for i := 0; i < PartitionCount; i++ {
+		logBuffers.Buffer(i)
+	}
+	if stats := logBuffers.Stats(); stats.ResidentTerms != PartitionCount {
+		t.Fatalf("expected all %d partitions resident before ReleaseIdle, got %d", PartitionCount, stats.ResidentTerms)
+	}
+
+	if err := logBuffers.ReleaseIdle(); err != nil {
+		t.Fatalf("ReleaseIdle: %v", err)
+	}
+
+	if stats := logBuffers.Stats(); stats.ResidentTerms != 1 {
+		t.Fatalf("expected 1 resident term after ReleaseIdle with cap 1, got %d", stats.ResidentTerms)
+	}
+}
+
+func TestReleaseIdleDoesNotUnmapAPinnedPartition(t *testing.T) {
+	logBuffers := WrapLazy(newLazyLogFile(t), WithResidentCap(0), WithIdleWindow(0))
+	defer logBuffers.Close()
+
+	buffer, release := logBuffers.AcquireBuffer(0)
+	defer release()
+
+	if err := logBuffers.ReleaseIdle(); err != nil {
+		t.Fatalf("ReleaseIdle: %v", err)
+	}
+
+	if stats := logBuffers.Stats(); stats.ResidentTerms != 1 {
+		t.Fatalf("expected pinned partition 0 to stay resident, got %d resident terms", stats.ResidentTerms)
+	}
+	if buffer.Capacity() == 0 {
+		t.Fatal("expected pinned buffer to remain valid after ReleaseIdle")
+	}
+}
+
+func TestReleaseIdleResetsBufferOnActualUnmap(t *testing.T) {
+	logBuffers := WrapLazy(newLazyLogFile(t), WithResidentCap(0), WithIdleWindow(0))
+	defer logBuffers.Close()
+
+	buffer := logBuffers.Buffer(0)
+	if buffer.Capacity() == 0 {
+		t.Fatal("expected freshly mapped buffer to have non-zero capacity")
+	}
+
+	if err := logBuffers.ReleaseIdle(); err != nil {
+		t.Fatalf("ReleaseIdle: %v", err)
+	}
+
+	if buffer.Capacity() != 0 {
+		t.Fatalf("expected unmapped partition's cached buffer to reset to zero capacity, got %d", buffer.Capacity())
+	}
+}
+
+func TestLogBuffersCloseIsIdempotent(t *testing.T) {
+	logBuffers := WrapLazy(newLazyLogFile(t))
+
+	if err := logBuffers.Close(); err != nil {
+		t.Fatalf("first Close: %v", err)
+	}
+	if err := logBuffers.Close(); err != nil {
+		t.Fatalf("second Close should be a no-op returning nil, got: %v", err)
+	}
+}
+
+func TestAcquireBufferRacingReleaseIdleNeverReturnsAZeroCapacityPin(t *testing.T) {
+	logBuffers := WrapLazy(newLazyLogFile(t), WithResidentCap(0), WithIdleWindow(0))
+	defer logBuffers.Close()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = logBuffers.ReleaseIdle()
+			}
+		}
+	}()
+
+	for i := 0; i < 2000; i++ {
+		buffer, release := logBuffers.AcquireBuffer(0)
+		if buffer.Capacity() == 0 {
+			close(stop)
+			wg.Wait()
+			t.Fatal("AcquireBuffer raced ReleaseIdle: pinned buffer observed with zero capacity")
+		}
+		release()
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestLogBuffersCloseDuringConcurrentReleaseIdle(t *testing.T) {
+	logBuffers := WrapLazy(newLazyLogFile(t), WithResidentCap(0), WithIdleWindow(0))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < PartitionCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					logBuffers.Buffer(i)
+					_ = logBuffers.ReleaseIdle()
+					time.Sleep(time.Microsecond)
+				}
+			}
+		}(i)
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := logBuffers.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/lirm/aeron-go/aeron/logbuffer"
+)
+
+// fragmentLengthPrefixLength is the size, in bytes, of the length prefix Publication.Offer
+// writes ahead of each fragment's tracing header and payload.
+const fragmentLengthPrefixLength = 4
+
+// noHeaderFlag is packed into the top bit of a fragment's length prefix to record, on the wire,
+// whether the sender wrote a tracing header ahead of the payload. Payload lengths never come
+// close to using that bit, so packing it in costs nothing and lets Image.Poll determine the
+// fragment's layout from the bytes actually written rather than from its own local tracer, which
+// may differ from the Publication's (e.g. the driver-level writer is a NoopTracer but the reading
+// Subscription is not).
+const noHeaderFlag = uint32(1) << 31
+
+// encodeFragmentLengthPrefix packs payloadLength and whether a tracing header precedes it into a
+// fragmentLengthPrefixLength-byte wire prefix.
+func encodeFragmentLengthPrefix(payloadLength int32, hasHeader bool) []byte {
+	prefix := make([]byte, fragmentLengthPrefixLength)
+	v := uint32(payloadLength)
+	if !hasHeader {
+		v |= noHeaderFlag
+	}
+	binary.LittleEndian.PutUint32(prefix, v)
+	return prefix
+}
+
+// decodeFragmentLengthPrefix unpacks a wire prefix written by encodeFragmentLengthPrefix back into
+// the payload length and whether a tracing header precedes it.
+func decodeFragmentLengthPrefix(prefix []byte) (payloadLength int32, hasHeader bool) {
+	v := binary.LittleEndian.Uint32(prefix)
+	return int32(v &^ noHeaderFlag), v&noHeaderFlag == 0
+}
+
+// Publication is a handle to a stream of messages sent to the media driver for delivery to all
+// connected Subscriptions.
+type Publication struct {
+	channel  string
+	streamID int32
+	tracer   Tracer
+
+	logBuffers *logbuffer.LogBuffers
+	termIndex  int
+
+	writeMu sync.Mutex
+	tail    int32
+}
+
+// newPublication builds a Publication over logBuffers, tagging every Offer with spans from
+// tracer. The ClientConductor supplies tracer from the Context the Publication was requested
+// against, defaulting to NoopTracer.
+func newPublication(channel string, streamID int32, logBuffers *logbuffer.LogBuffers, tracer Tracer) *Publication {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+
+	return &Publication{
+		channel:    channel,
+		streamID:   streamID,
+		tracer:     tracer,
+		logBuffers: logBuffers,
+	}
+}
+
+// Close unmaps the Publication's underlying log buffer. The ClientConductor calls this once the
+// publication is released or the conductor itself is closed; callers don't call it directly.
+func (pub *Publication) Close() error {
+	return pub.logBuffers.Close()
+}
+
+// Offer appends payload as a new fragment to the active term, returning the new stream position.
+// Before the fragment is committed, Offer starts a "publish" span with no parent, so each Offer
+// begins a new trace, and injects its SpanContext into the fragment's reserved tracing header; the
+// span is finished once the append succeeds. A NoopTracer is special-cased: no header is
+// allocated, injected, or written to the wire, so callers who don't opt into tracing pay nothing
+// beyond the no-op StartSpan/Finish calls. Whether a header was written is itself recorded in the
+// fragment's length prefix, so Image.Poll reads it off the wire rather than assuming its own
+// locally-configured tracer matches the Publication's.
+func (pub *Publication) Offer(payload []byte) (int64, error) {
+	span := pub.tracer.StartSpan("publish", nil)
+	defer span.Finish()
+
+	_, hasHeader := pub.tracer.(NoopTracer)
+	hasHeader = !hasHeader
+	headerLength := int32(0)
+
+	var header []byte
+	if hasHeader {
+		headerLength = spanHeaderReservedLength
+		header = make([]byte, headerLength)
+		if _, err := pub.tracer.Inject(span.Context(), header); err != nil {
+			return 0, fmt.Errorf("publication %s/%d: inject span: %w", pub.channel, pub.streamID, err)
+		}
+	}
+
+	recordLength := fragmentLengthPrefixLength + headerLength + int32(len(payload))
+
+	pub.writeMu.Lock()
+	defer pub.writeMu.Unlock()
+
+	buffer, release := pub.logBuffers.AcquireBuffer(pub.termIndex)
+	defer release()
+
+	offset := pub.tail
+	if offset+recordLength > buffer.Capacity() {
+		return 0, fmt.Errorf("publication %s/%d: term is full", pub.channel, pub.streamID)
+	}
+
+	lengthPrefix := encodeFragmentLengthPrefix(int32(len(payload)), hasHeader)
+
+	buffer.PutBytes(offset, lengthPrefix)
+	if hasHeader {
+		buffer.PutBytes(offset+fragmentLengthPrefixLength, header)
+	}
+	buffer.PutBytes(offset+fragmentLengthPrefixLength+headerLength, payload)
+
+	pub.tail += recordLength
+
+	span.SetTag("aeron.channel", pub.channel).SetTag("aeron.stream_id", pub.streamID)
+
+	return int64(pub.tail), nil
+}
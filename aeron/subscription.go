@@ -0,0 +1,91 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import "sync"
+
+// Subscription represents a consumer's registration for a stream of messages published on
+// channel/streamID. A Subscription accumulates one Image per connected publisher, as the
+// ClientConductor attaches them via addImage. Poll visits them in the order they were attached,
+// starting from the first on every call, so an earlier Image can use up the whole fragment limit
+// before a later one is polled.
+type Subscription struct {
+	channel        string
+	streamID       int32
+	registrationID int64
+
+	mu     sync.Mutex
+	images []*Image
+}
+
+// newSubscription builds a Subscription once the driver has confirmed the registration;
+// Images are attached afterwards as they become available.
+func newSubscription(channel string, streamID int32, registrationID int64) *Subscription {
+	return &Subscription{
+		channel:        channel,
+		streamID:       streamID,
+		registrationID: registrationID,
+	}
+}
+
+// addImage attaches a newly available Image to the subscription.
+func (sub *Subscription) addImage(image *Image) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.images = append(sub.images, image)
+}
+
+// removeImage detaches image from the subscription, e.g. once its publisher has gone away.
+func (sub *Subscription) removeImage(image *Image) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for i, img := range sub.images {
+		if img == image {
+			sub.images = append(sub.images[:i], sub.images[i+1:]...)
+			return
+		}
+	}
+}
+
+// Images returns a snapshot of the Images currently backing this subscription.
+func (sub *Subscription) Images() []*Image {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	images := make([]*Image, len(sub.images))
+	copy(images, sub.images)
+	return images
+}
+
+// IsConnected reports whether the subscription currently has at least one connected Image.
+func (sub *Subscription) IsConnected() bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return len(sub.images) > 0
+}
+
+// Poll delivers up to fragmentLimit fragments across all of the subscription's Images, returning
+// the number of fragments delivered. See Image.Poll for what each fragment handler receives.
+func (sub *Subscription) Poll(handler AssemblerWithSpan, fragmentLimit int) int {
+	polled := 0
+	for _, image := range sub.Images() {
+		if polled >= fragmentLimit {
+			break
+		}
+		polled += image.Poll(handler, fragmentLimit-polled)
+	}
+	return polled
+}
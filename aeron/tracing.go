@@ -0,0 +1,99 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aeron
+
+import "github.com/lirm/aeron-go/aeron/atomic"
+
+// AssemblerWithSpan is the fragment handler signature used by Image.Poll when tracing is in
+// play: it receives the same (buffer, offset, length) a plain fragment handler would, plus the
+// Span that Poll started for this fragment (a child of the SpanContext extracted from the
+// fragment's reserved tracing header, or a new trace if none was propagated). Handlers may add
+// tags to span, or start further child spans from it, but must not call Finish on it themselves;
+// Poll finishes it once the handler returns.
+type AssemblerWithSpan func(buffer *atomic.Buffer, offset int32, length int32, span Span)
+
+// SpanContext carries the propagated tracing identifiers across a publication/subscription
+// boundary: the trace and span identifiers, whether the trace is sampled, and any baggage items
+// attached by the caller. It is the payload that gets serialized into the reserved span header.
+type SpanContext struct {
+	TraceID uint64
+	SpanID  uint64
+	Sampled bool
+	Baggage map[string]string
+}
+
+// Span represents a single unit of work tracked by a Tracer, e.g. a single Offer or a single
+// fragment delivered to a handler. Finish must be called exactly once to record its duration.
+type Span interface {
+	// Context returns the SpanContext to propagate to a child span, e.g. across the wire.
+	Context() SpanContext
+
+	// SetTag attaches a key/value pair to the span for later inspection in the tracing backend.
+	SetTag(key string, value interface{}) Span
+
+	// Finish marks the span as complete.
+	Finish()
+}
+
+// Tracer is the extension point for distributed tracing backends (Zipkin, Jaeger, or a no-op
+// implementation for callers who don't opt in). It mirrors the OpenTracing model so existing
+// instrumentation libraries can be adapted with a thin shim.
+type Tracer interface {
+	// StartSpan begins a new span with the given operation name. If a parent SpanContext is
+	// supplied the new span is a child of it; otherwise it starts a new trace.
+	StartSpan(operationName string, parent *SpanContext) Span
+
+	// Inject serializes a SpanContext into the reserved header bytes of an outgoing fragment.
+	Inject(sc SpanContext, header []byte) (int, error)
+
+	// Extract deserializes a SpanContext from the reserved header bytes of an incoming fragment.
+	// It returns false if the header does not contain a propagated context, e.g. because the
+	// sender is running with a NoopTracer.
+	Extract(header []byte) (SpanContext, bool)
+}
+
+// spanHeaderReservedLength is the number of bytes reserved at the front of a fragment's header
+// extension for a serialized SpanContext. It is sized to hold the trace/span ids, the sampled
+// flag, and a small fixed amount of baggage; Inject/Extract implementations must not exceed it.
+const spanHeaderReservedLength = 64
+
+// NoopSpan is the Span returned by NoopTracer. All of its methods are no-ops so that instrumenting
+// the hot path with a NoopTracer costs nothing beyond the interface call itself.
+type NoopSpan struct{}
+
+// Context implements Span.
+func (NoopSpan) Context() SpanContext { return SpanContext{} }
+
+// SetTag implements Span.
+func (s NoopSpan) SetTag(string, interface{}) Span { return s }
+
+// Finish implements Span.
+func (NoopSpan) Finish() {}
+
+// NoopTracer is the default Tracer used when a Context is not configured with one. It never
+// allocates a SpanContext and Extract always reports that nothing was propagated, so callers who
+// don't opt into tracing pay no cost on the Offer/Poll hot path.
+type NoopTracer struct{}
+
+// StartSpan implements Tracer.
+func (NoopTracer) StartSpan(string, *SpanContext) Span { return NoopSpan{} }
+
+// Inject implements Tracer.
+func (NoopTracer) Inject(SpanContext, []byte) (int, error) { return 0, nil }
+
+// Extract implements Tracer.
+func (NoopTracer) Extract([]byte) (SpanContext, bool) { return SpanContext{}, false }
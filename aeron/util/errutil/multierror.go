@@ -0,0 +1,59 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package errutil provides small helpers for aggregating errors from a batch of operations that
+// should all be attempted even if one of them fails, e.g. closing several memory maps in turn.
+package errutil
+
+import "strings"
+
+// MultiError accumulates zero or more errors. Its zero value is ready to use. Wrap each error
+// added with its source (which file, which subsystem) before calling Add so the aggregated
+// message stays useful once several failures are joined together.
+type MultiError struct {
+	errs []error
+}
+
+// Add appends err to the accumulated errors. A nil err is ignored.
+func (m *MultiError) Add(err error) {
+	if err != nil {
+		m.errs = append(m.errs, err)
+	}
+}
+
+// ErrorOrNil returns m if it has accumulated at least one error, or nil otherwise. Callers should
+// return the result of ErrorOrNil rather than m directly, so a MultiError with nothing in it
+// doesn't get mistaken for a non-nil error.
+func (m *MultiError) ErrorOrNil() error {
+	if len(m.errs) == 0 {
+		return nil
+	}
+	return m
+}
+
+// Error implements the error interface by joining each accumulated error's message.
+func (m *MultiError) Error() string {
+	msgs := make([]string, len(m.errs))
+	for i, err := range m.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap exposes the accumulated errors so callers can use errors.Is/errors.As against them.
+func (m *MultiError) Unwrap() []error {
+	return m.errs
+}
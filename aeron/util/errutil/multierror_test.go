@@ -0,0 +1,57 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errutil
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMultiErrorErrorOrNilWithNoErrorsAdded(t *testing.T) {
+	var merr MultiError
+	if err := merr.ErrorOrNil(); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+}
+
+func TestMultiErrorIgnoresNilAdds(t *testing.T) {
+	var merr MultiError
+	merr.Add(nil)
+	if err := merr.ErrorOrNil(); err != nil {
+		t.Fatalf("expected nil after adding only nils, got %v", err)
+	}
+}
+
+func TestMultiErrorPreservesEachAddedError(t *testing.T) {
+	errA := errors.New("unmap section 0")
+	errB := errors.New("unmap section 1")
+
+	var merr MultiError
+	merr.Add(errA)
+	merr.Add(errB)
+
+	err := merr.ErrorOrNil()
+	if err == nil {
+		t.Fatal("expected a non-nil error")
+	}
+	if !errors.Is(err, errA) {
+		t.Errorf("expected errors.Is to find errA")
+	}
+	if !errors.Is(err, errB) {
+		t.Errorf("expected errors.Is to find errB")
+	}
+}
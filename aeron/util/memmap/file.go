@@ -0,0 +1,85 @@
+/*
+Copyright 2016 Stanislav Liberman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package memmap provides memory-mapped access to files backing Aeron's CnC file and log
+// buffers.
+package memmap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// File is a single memory-mapped region of a file on disk.
+type File struct {
+	data []byte
+}
+
+// GetFileSize returns the size, in bytes, of the file at fileName. It panics if the file cannot
+// be stat'd, matching the panic-on-setup-failure convention used elsewhere when wrapping a log
+// buffer.
+func GetFileSize(fileName string) int64 {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		panic(err)
+	}
+	return info.Size()
+}
+
+// MapExisting maps length bytes of the already-existing file at fileName, starting at offset. A
+// length of 0 maps from offset to the end of the file.
+func MapExisting(fileName string, offset int64, length int) (*File, error) {
+	osFile, err := os.OpenFile(fileName, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer osFile.Close()
+
+	if length == 0 {
+		info, err := osFile.Stat()
+		if err != nil {
+			return nil, err
+		}
+		length = int(info.Size() - offset)
+	}
+
+	data, err := syscall.Mmap(int(osFile.Fd()), offset, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{data: data}, nil
+}
+
+// GetMemoryPtr returns a pointer to the start of the mapped region.
+func (file *File) GetMemoryPtr() unsafe.Pointer {
+	if len(file.data) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&file.data[0])
+}
+
+// Close unmaps the region. It is idempotent: a second call is a no-op that returns nil.
+func (file *File) Close() error {
+	if file.data == nil {
+		return nil
+	}
+
+	err := syscall.Munmap(file.data)
+	file.data = nil
+	return err
+}